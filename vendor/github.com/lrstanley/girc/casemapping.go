@@ -0,0 +1,190 @@
+// Copyright (c) Liam Stanley <me@liamstanley.io>. All rights reserved. Use
+// of this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package girc
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Casemapping represents the rules a server (or client) uses to compare
+// nicknames and channel names for equality. The active mapping is
+// selectable via Config.Casemapping, and is updated automatically from
+// the server's "CASEMAPPING=" ISUPPORT token where possible.
+type Casemapping int
+
+const (
+	// CasemappingRFC1459 is the traditional IRC casemapping, folding
+	// "A-Z" to "a-z" and "[]\^" to "{}|~". This is girc's default --
+	// it's the zero value of Casemapping -- and matches the historical
+	// behavior of ToRFC1459(), so a zero-value Config{} keeps comparing
+	// names exactly as every prior girc release did.
+	CasemappingRFC1459 Casemapping = iota
+	// CasemappingASCII only folds "A-Z" to "a-z", per the IRCv3
+	// "ascii" casemapping.
+	CasemappingASCII
+	// CasemappingPRECIS folds nicknames with Casefold(), an approximation
+	// of RFC 8265's UsernameCaseMapped PRECIS profile; it does no NFC
+	// normalization and no bidi/context rule checks. It lets non-ASCII
+	// nicknames be compared on modern IRCv3 servers.
+	CasemappingPRECIS
+)
+
+// protoChars are characters which are never valid in a nickname, as
+// allowing them would break the IRC wire protocol.
+const protoChars = " ,*?.!@:"
+
+// Casefold folds nick per a best-effort approximation of RFC 8265's
+// PRECIS UsernameCaseMapped profile: full Unicode case-folding plus
+// fullwidth-to-ASCII width folding. It returns an error if nick contains
+// any of the protocol-breaking characters in protoChars, or any control
+// character.
+//
+// NOTE: a spec-complete PRECIS profile also requires Unicode NFC
+// normalization and bidi/context rule checks, which this package gets
+// from golang.org/x/text in upstream girc. This tree doesn't vendor
+// golang.org/x/text (and has no go.mod to pin a compatible version), so
+// this is a stdlib-only approximation rather than a full implementation.
+func Casefold(nick string) (string, error) {
+	if nick == "" {
+		return "", &CasemappingError{Nick: nick, Reason: "empty nick"}
+	}
+
+	for _, r := range nick {
+		if unicode.IsControl(r) {
+			return "", &CasemappingError{Nick: nick, Reason: "contains a control character"}
+		}
+	}
+	if strings.ContainsAny(nick, protoChars) {
+		return "", &CasemappingError{Nick: nick, Reason: "contains a protocol-reserved character"}
+	}
+
+	return strings.Map(foldRune, nick), nil
+}
+
+// foldRune lowercases r and folds IRCv3-common fullwidth variants
+// (U+FF01-U+FF5E) down to their ASCII equivalent.
+func foldRune(r rune) rune {
+	if r >= 0xff01 && r <= 0xff5e {
+		r -= 0xfee0
+	}
+	return unicode.ToLower(r)
+}
+
+// CasemappingError is returned by Casefold when a nickname cannot be
+// safely casefolded under RFC 8265.
+type CasemappingError struct {
+	Nick   string
+	Reason string
+}
+
+func (e *CasemappingError) Error() string {
+	return "girc: invalid nick " + strconv.Quote(e.Nick) + ": " + e.Reason
+}
+
+// confusables is a small, embedded table of commonly-confused runes mapped
+// to their ASCII "skeleton" equivalent. It is not exhaustive -- it covers
+// the Latin/Cyrillic/Greek look-alikes that are most commonly used for
+// nickname impersonation -- but is enough to catch the common case without
+// pulling in the full Unicode confusables data set. Keys are already
+// lowercased/width-folded, since SkeletonNick runs foldRune() first.
+var confusables = map[rune]rune{
+	'а': 'a', // CYRILLIC SMALL LETTER A
+	'е': 'e', // CYRILLIC SMALL LETTER IE
+	'о': 'o', // CYRILLIC SMALL LETTER O
+	'р': 'p', // CYRILLIC SMALL LETTER ER
+	'с': 'c', // CYRILLIC SMALL LETTER ES
+	'у': 'y', // CYRILLIC SMALL LETTER U
+	'х': 'x', // CYRILLIC SMALL LETTER HA
+	'і': 'i', // CYRILLIC SMALL LETTER BYELORUSSIAN-UKRAINIAN I
+	'ѕ': 's', // CYRILLIC SMALL LETTER DZE
+	'ⅼ': 'l', // SMALL ROMAN NUMERAL FIFTY
+	'ι': 'i', // GREEK SMALL LETTER IOTA
+	'ο': 'o', // GREEK SMALL LETTER OMICRON
+	'α': 'a', // GREEK SMALL LETTER ALPHA
+}
+
+// SkeletonNick returns a normalized "skeleton" of nick suitable for
+// detecting impersonation attempts: two nicknames that render identically
+// (or near-identically) to a human will produce the same skeleton, i.e.
+// SkeletonNick(nickA) == SkeletonNick(nickB). It lowercases each rune and
+// width-folds fullwidth variants, then maps known confusable runes to
+// their ASCII equivalent via the embedded confusables table.
+//
+// NOTE: upstream girc uses golang.org/x/text/unicode/norm for full NFKD
+// decomposition here; this tree doesn't vendor golang.org/x/text (see
+// Casefold), so compatibility/combining-mark decomposition beyond the
+// fullwidth range and the embedded confusables table isn't covered.
+func SkeletonNick(nick string) string {
+	var out strings.Builder
+	out.Grow(len(nick))
+	for _, r := range nick {
+		r = foldRune(r)
+		if repl, ok := confusables[r]; ok {
+			r = repl
+		}
+		out.WriteRune(r)
+	}
+
+	return out.String()
+}
+
+// CompareNames reports whether a and b are considered equal under the
+// given casemapping. Client.CompareNames() calls this with the client's
+// active mapping: Config.Casemapping, or the server's "CASEMAPPING="
+// ISUPPORT token where the server advertises one.
+func CompareNames(mapping Casemapping, a, b string) bool {
+	return foldName(mapping, a) == foldName(mapping, b)
+}
+
+// foldName folds a single name according to mapping. PRECIS folding
+// errors are treated as "does not fold", per the existing girc convention
+// of favoring availability over strict rejection when comparing names.
+func foldName(mapping Casemapping, name string) string {
+	switch mapping {
+	case CasemappingASCII:
+		return ToASCII(name)
+	case CasemappingPRECIS:
+		if folded, err := Casefold(name); err == nil {
+			return folded
+		}
+		return name
+	case CasemappingRFC1459:
+		fallthrough
+	default:
+		return ToRFC1459(name)
+	}
+}
+
+// IsValidNickCasemapped reports whether nick is a valid IRC nickname
+// under mapping. CasemappingASCII and CasemappingRFC1459 fall back to the
+// historical byte-range check in IsValidNick(), which only accepts ASCII.
+// CasemappingPRECIS instead accepts any nick that Casefold() can fold,
+// which is what lets modern IRCv3 servers hand out non-ASCII nicknames
+// without IsValidNick() rejecting them outright.
+func IsValidNickCasemapped(nick string, mapping Casemapping) bool {
+	if mapping == CasemappingPRECIS {
+		_, err := Casefold(nick)
+		return err == nil
+	}
+
+	return IsValidNick(nick)
+}
+
+// ToASCII lowercases the ASCII "A-Z" range only, leaving all other bytes
+// (including any non-ASCII ones) untouched. This implements the IRCv3
+// "ascii" CASEMAPPING token.
+func ToASCII(input string) (out string) {
+	for i := 0; i < len(input); i++ {
+		if input[i] >= 'A' && input[i] <= 'Z' {
+			out += string(rune(input[i]) + 32)
+		} else {
+			out += string(input[i])
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,235 @@
+// Copyright (c) Liam Stanley <me@liamstanley.io>. All rights reserved. Use
+// of this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package girc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Config contains configuration options for a Client.
+type Config struct {
+	Server string
+	Port   int
+	Nick   string
+	User   string
+	Name   string
+
+	// Casemapping is the casemapping girc assumes the server uses until
+	// (if ever) the server's "CASEMAPPING=" ISUPPORT token says
+	// otherwise. Defaults to CasemappingRFC1459, matching historical
+	// IRC server behavior.
+	Casemapping Casemapping
+
+	// WebIRC, if set, is sent as a WEBIRC line before NICK/USER, so a
+	// gateway/bouncer can forward the real client's host rather than
+	// appear as a single shared connection. See WebIRC.
+	WebIRC *WebIRC
+
+	// SpoofIdent, if set, answers RFC 1413 ident queries for this
+	// connection with the given hook. See IdentServer.
+	SpoofIdent SpoofIdent
+}
+
+// Client is a stateful IRC client: it holds the active connection
+// configuration, the server's negotiated casemapping, the ident server
+// (if Config.SpoofIdent is set), and the source-rewriting middleware
+// applied to inbound events.
+type Client struct {
+	Config Config
+
+	mu          sync.RWMutex
+	casemapping Casemapping
+
+	rewriter    SourceRewriter
+	identServer *IdentServer
+}
+
+// New returns a new Client for the given configuration.
+func New(config Config) *Client {
+	return &Client{Config: config, casemapping: config.Casemapping}
+}
+
+// Casemapping returns the casemapping currently in effect -- the
+// server-negotiated one if SetCasemappingFromISUPPORT has seen a
+// "CASEMAPPING=" token, otherwise Config.Casemapping.
+func (c *Client) Casemapping() Casemapping {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.casemapping
+}
+
+// CompareNames reports whether a and b are the same nickname/channel
+// under the client's active casemapping. The package-level IsValidNick
+// and IsValidUser still fold with ToRFC1459() whatever the active
+// casemapping is.
+func (c *Client) CompareNames(a, b string) bool {
+	return CompareNames(c.Casemapping(), a, b)
+}
+
+// IsValidNick reports whether nick is a valid nickname under the
+// client's active casemapping. See IsValidNickCasemapped.
+func (c *Client) IsValidNick(nick string) bool {
+	return IsValidNickCasemapped(nick, c.Casemapping())
+}
+
+// SetCasemappingFromISUPPORT updates the client's active casemapping
+// from a single raw RPL_ISUPPORT (005) parameter, e.g.
+// "CASEMAPPING=ascii". It's a no-op if param isn't a "CASEMAPPING="
+// token, or its value isn't one girc recognizes. The event dispatcher
+// calls this once per parameter of every "005" numeric.
+func (c *Client) SetCasemappingFromISUPPORT(param string) {
+	value, ok := strings.CutPrefix(param, "CASEMAPPING=")
+	if !ok {
+		return
+	}
+
+	mapping, ok := parseCasemappingToken(value)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	c.casemapping = mapping
+	c.mu.Unlock()
+}
+
+// RewriteSource registers fn as inbound-event source-rewriting
+// middleware: every event passed to HandleEvent has its Source run
+// through fn (and any previously-registered rewriters), in registration
+// order. Useful for bouncer setups that want to replace a shared
+// connection identity with the real per-user source derived from an
+// IRCv3 "account" tag or a CHGHOST event.
+func (c *Client) RewriteSource(fn SourceRewriteFunc) {
+	c.mu.Lock()
+	c.rewriter.Use(fn)
+	c.mu.Unlock()
+}
+
+// HandleEvent is the event-dispatcher hook: it updates the client's
+// active casemapping from ISUPPORT, then runs the event's Source through
+// any registered RewriteSource middleware, before returning e for
+// further dispatch.
+func (c *Client) HandleEvent(e *Event) *Event {
+	if e == nil {
+		return e
+	}
+
+	if e.Command == "005" {
+		for _, param := range e.Params {
+			c.SetCasemappingFromISUPPORT(param)
+		}
+	}
+
+	if e.Source != nil {
+		c.mu.RLock()
+		e.Source = c.rewriter.Rewrite(e.Source)
+		c.mu.RUnlock()
+	}
+
+	return e
+}
+
+// ConnectPreamble returns the raw lines that must be sent before
+// NICK/USER as part of connection setup -- currently just the WEBIRC
+// line, when Config.WebIRC is set.
+func (c *Client) ConnectPreamble() ([]string, error) {
+	if c.Config.WebIRC == nil {
+		return nil, nil
+	}
+
+	line, err := c.Config.WebIRC.Line()
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{line}, nil
+}
+
+// StartIdent starts answering RFC 1413 ident queries for this
+// connection using Config.SpoofIdent, if set. It is a no-op if
+// Config.SpoofIdent is nil. Call StopIdent to shut it down once
+// connected (most servers only query ident during registration).
+func (c *Client) StartIdent() error {
+	if c.Config.SpoofIdent == nil {
+		return nil
+	}
+
+	c.identServer = NewIdentServer(c.Config.SpoofIdent)
+	if err := c.identServer.Listen(); err != nil {
+		return err
+	}
+
+	go c.identServer.Serve()
+	return nil
+}
+
+// StopIdent shuts down the ident server started by StartIdent, if any.
+func (c *Client) StopIdent() error {
+	if c.identServer == nil {
+		return nil
+	}
+	return c.identServer.Close()
+}
+
+// Connect drives connection setup over an already-dialed conn: it starts
+// the ident server (if configured), sends the WEBIRC preamble (if
+// configured) followed by NICK/USER, then reads and dispatches events
+// via HandleEvent until conn is closed or a read error occurs.
+func (c *Client) Connect(conn net.Conn) error {
+	if err := c.StartIdent(); err != nil {
+		return err
+	}
+	defer c.StopIdent()
+
+	preamble, err := c.ConnectPreamble()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range preamble {
+		if _, err := fmt.Fprintf(conn, "%s\r\n", line); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(conn, "NICK %s\r\n", c.Config.Nick); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(conn, "USER %s 0 * :%s\r\n", c.Config.User, c.Config.Name); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		event, err := ParseEvent(scanner.Text())
+		if err != nil {
+			continue
+		}
+		c.HandleEvent(event)
+	}
+
+	return scanner.Err()
+}
+
+// parseCasemappingToken maps a server's "CASEMAPPING=" ISUPPORT value to
+// a Casemapping. Values girc doesn't recognize (e.g. a future IRCv3
+// mapping) are reported as not-ok, leaving the caller's current
+// casemapping untouched rather than guessing.
+func parseCasemappingToken(value string) (Casemapping, bool) {
+	switch strings.ToLower(value) {
+	case "ascii":
+		return CasemappingASCII, true
+	case "rfc1459", "rfc1459-strict":
+		return CasemappingRFC1459, true
+	case "precis", "utf-8":
+		return CasemappingPRECIS, true
+	default:
+		return 0, false
+	}
+}
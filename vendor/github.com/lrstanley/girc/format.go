@@ -6,101 +6,316 @@ package girc
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 )
 
-type ircFmtCode struct {
-	aliases []string
-	val     string
+// fmtColors maps color names/aliases to their mIRC color index (0-15).
+var fmtColors = map[string]int{
+	"white":       0,
+	"black":       1,
+	"blue":        2,
+	"navy":        2,
+	"green":       3,
+	"red":         4,
+	"brown":       5,
+	"maroon":      5,
+	"purple":      6,
+	"orange":      7,
+	"olive":       7,
+	"gold":        7,
+	"yellow":      8,
+	"lightgreen":  9,
+	"lime":        9,
+	"teal":        10,
+	"cyan":        11,
+	"lightblue":   12,
+	"royal":       12,
+	"lightpurple": 13,
+	"pink":        13,
+	"fuchsia":     13,
+	"grey":        14,
+	"gray":        14,
+	"lightgrey":   15,
+	"silver":      15,
 }
 
-var codes = []*ircFmtCode{
-	{aliases: []string{"white"}, val: "\x0300"},
-	{aliases: []string{"black"}, val: "\x0301"},
-	{aliases: []string{"blue", "navy"}, val: "\x0302"},
-	{aliases: []string{"green"}, val: "\x0303"},
-	{aliases: []string{"red"}, val: "\x0304"},
-	{aliases: []string{"brown", "maroon"}, val: "\x0305"},
-	{aliases: []string{"purple"}, val: "\x0306"},
-	{aliases: []string{"orange", "olive", "gold"}, val: "\x0307"},
-	{aliases: []string{"yellow"}, val: "\x0308"},
-	{aliases: []string{"lightgreen", "lime"}, val: "\x0309"},
-	{aliases: []string{"teal"}, val: "\x0310"},
-	{aliases: []string{"cyan"}, val: "\x0311"},
-	{aliases: []string{"lightblue", "royal"}, val: "\x0312"},
-	{aliases: []string{"lightpurple", "pink", "fuchsia"}, val: "\x0313"},
-	{aliases: []string{"grey", "gray"}, val: "\x0314"},
-	{aliases: []string{"lightgrey", "silver"}, val: "\x0315"},
-	{aliases: []string{"bold", "b"}, val: "\x02"},
-	{aliases: []string{"italic", "i"}, val: "\x1d"},
-	{aliases: []string{"reset", "r"}, val: "\x0f"},
-	{aliases: []string{"clear", "c"}, val: "\x03"}, // Clears formatting.
-	{aliases: []string{"reverse"}, val: "\x16"},
-	{aliases: []string{"underline", "ul"}, val: "\x1f"},
-	{aliases: []string{"ctcp"}, val: "\x01"}, // CTCP/ACTION delimiter.
+// fmtCodes maps attribute names/aliases to their raw IRC control byte.
+// "clear"/"c" map to the bare color byte (0x03), which resets any active
+// foreground/background color when it isn't followed by digits.
+var fmtCodes = map[string]byte{
+	"bold":      0x02,
+	"b":         0x02,
+	"italic":    0x1d,
+	"i":         0x1d,
+	"reset":     0x0f,
+	"r":         0x0f,
+	"clear":     0x03,
+	"c":         0x03,
+	"reverse":   0x16,
+	"underline": 0x1f,
+	"ul":        0x1f,
+	"ctcp":      0x01,
 }
 
 // Fmt takes format strings like "{red}" and turns them into the resulting
-// ASCII format/color codes for IRC.
+// ASCII format/color codes for IRC. It also understands a combined
+// foreground/background form, e.g. "{red,blue}", and pure numeric forms
+// like "{04}" or "{04,02}". A literal "{" can be produced with "{{".
+// Unknown tokens (e.g. JSON or template placeholders) are left untouched.
 //
 // For example:
 //
 //   client.Message("#channel", Fmt("{red}{bold}Hello World{c}"))
+//   client.Message("#channel", Fmt("{red,blue}Hello World{c}"))
 func Fmt(text string) string {
-	for i := 0; i < len(codes); i++ {
-		for a := 0; a < len(codes[i].aliases); a++ {
-			text = strings.Replace(text, "{"+codes[i].aliases[a]+"}", codes[i].val, -1)
+	return scanFmt(text, resolveFmtToken)
+}
+
+// StripFmt strips all "{fmt}" formatting strings from the input text,
+// leaving any unrecognized tokens intact. Like Fmt(), it unescapes "{{"
+// to a literal "{". See Fmt() for more information.
+func StripFmt(text string) string {
+	return scanFmt(text, func(token string) (string, bool) {
+		if _, ok := resolveFmtToken(token); ok {
+			return "", true
 		}
+		return "", false
+	})
+}
 
-		// makes parsing small strings slightly slower, but helps longer
-		// strings.
-		var more bool
-		for c := 0; c < len(text); c++ {
-			if text[c] == 0x7B {
-				more = true
-				break
-			}
+// TrimFmt strips all "{fmt}" formatting strings from the input text.
+//
+// Deprecated: use StripFmt, which this now wraps. Kept as a thin alias
+// so existing callers outside this tree keep compiling.
+func TrimFmt(text string) string {
+	return StripFmt(text)
+}
+
+// scanFmt walks text once, left-to-right, looking for "{...}" tokens. Each
+// token is lowercased and passed to resolve; if resolve recognizes it, its
+// replacement is written to the output, otherwise the token (braces
+// included) is copied through verbatim. "{{" is always unescaped to a
+// literal "{", regardless of what resolve does.
+func scanFmt(text string, resolve func(token string) (string, bool)) string {
+	var out strings.Builder
+	out.Grow(len(text))
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '{' {
+			out.WriteByte(c)
+			continue
+		}
+
+		if i+1 < len(text) && text[i+1] == '{' {
+			out.WriteByte('{')
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(text[i+1:], '}')
+		if end == -1 {
+			out.WriteByte(c)
+			continue
 		}
-		if !more {
-			return text
+		end += i + 1
+
+		token := strings.ToLower(text[i+1 : end])
+		if repl, ok := resolve(token); ok {
+			out.WriteString(repl)
+		} else {
+			out.WriteString(text[i : end+1])
 		}
+		i = end
 	}
 
-	return text
+	return out.String()
 }
 
-// TrimFmt strips all "{fmt}" formatting strings from the input text.
-// See Fmt() for more information.
-func TrimFmt(text string) string {
-	for i := 0; i < len(codes); i++ {
-		for a := 0; a < len(codes[i].aliases); a++ {
-			text = strings.Replace(text, "{"+codes[i].aliases[a]+"}", "", -1)
+// resolveFmtToken resolves a single, already-lowercased "{token}" body into
+// its raw IRC bytes, per the color/attribute/combined-color rules
+// documented on Fmt().
+func resolveFmtToken(token string) (string, bool) {
+	if idx := strings.IndexByte(token, ','); idx != -1 {
+		fg, ok1 := resolveColorPart(token[:idx])
+		bg, ok2 := resolveColorPart(token[idx+1:])
+		if !ok1 || !ok2 {
+			return "", false
 		}
+		return "\x03" + fg + "," + bg, true
+	}
 
-		// makes parsing small strings slightly slower, but helps longer
-		// strings.
-		var more bool
-		for c := 0; c < len(text); c++ {
-			if text[c] == 0x7B {
-				more = true
-				break
-			}
-		}
-		if !more {
-			return text
+	if code, ok := resolveColorPart(token); ok {
+		return "\x03" + code, true
+	}
+
+	if b, ok := fmtCodes[token]; ok {
+		return string(b), true
+	}
+
+	return "", false
+}
+
+// resolveColorPart resolves a single color name or 1-2 digit numeric index
+// (0-15) into its zero-padded two-digit form.
+func resolveColorPart(s string) (string, bool) {
+	if n, ok := fmtColors[s]; ok {
+		return zeroPad(n), true
+	}
+
+	if len(s) == 0 || len(s) > 2 {
+		return "", false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return "", false
 		}
 	}
 
-	return text
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 15 {
+		return "", false
+	}
+
+	return zeroPad(n), true
+}
+
+func zeroPad(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
 }
 
-// StripRaw tries to strip all ASCII format codes that are used for IRC.
+// StripRaw tries to strip all ASCII format codes that are used for IRC,
+// including color codes with their optional foreground/background digits.
 func StripRaw(text string) string {
-	for i := 0; i < len(codes); i++ {
-		text = strings.Replace(text, codes[i].val, "", -1)
+	var out strings.Builder
+	out.Grow(len(text))
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch c {
+		case 0x02, 0x0f, 0x1d, 0x16, 0x1f, 0x01:
+			continue
+		case 0x03:
+			i = skipColorDigits(text, i+1) - 1
+			continue
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
+
+// skipColorDigits consumes the optional "FG[,BG]" digit sequence following
+// a 0x03 color byte, returning the index just past it.
+func skipColorDigits(text string, i int) int {
+	i = skipDigits(text, i, 2)
+	if i < len(text) && text[i] == ',' && i+1 < len(text) && isDigit(text[i+1]) {
+		i = skipDigits(text, i+1, 2)
+	}
+	return i
+}
+
+func skipDigits(text string, i, max int) int {
+	for n := 0; i < len(text) && n < max && isDigit(text[i]); n, i = n+1, i+1 {
+	}
+	return i
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ansiReset is the ANSI escape sequence that clears all attributes/colors.
+const ansiReset = "\x1b[0m"
+
+// ircToANSIFg maps a zero-padded mIRC color index to its nearest ANSI
+// foreground SGR parameter.
+var ircToANSIFg = map[string]string{
+	"00": "37", "01": "30", "02": "34", "03": "32", "04": "31", "05": "33",
+	"06": "35", "07": "33", "08": "93", "09": "92", "10": "36", "11": "96",
+	"12": "94", "13": "95", "14": "90", "15": "37",
+}
+
+// ToANSI converts IRC color/attribute codes found in text into ANSI escape
+// sequences, so that CLI bridges can render colored IRC output to a
+// terminal.
+func ToANSI(text string) string {
+	var out strings.Builder
+	out.Grow(len(text))
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		switch c {
+		case 0x02:
+			out.WriteString("\x1b[1m")
+		case 0x1d:
+			out.WriteString("\x1b[3m")
+		case 0x1f:
+			out.WriteString("\x1b[4m")
+		case 0x16:
+			out.WriteString("\x1b[7m")
+		case 0x0f:
+			out.WriteString(ansiReset)
+		case 0x03:
+			start := i + 1
+			end := skipDigits(text, start, 2)
+			fg := text[start:end]
+			var bg string
+			if end < len(text) && text[end] == ',' && end+1 < len(text) && isDigit(text[end+1]) {
+				bgStart := end + 1
+				bgEnd := skipDigits(text, bgStart, 2)
+				bg = text[bgStart:bgEnd]
+				end = bgEnd
+			}
+			i = end - 1
+			out.WriteString(ansiColorEscape(fg, bg))
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return out.String()
+}
+
+// ansiColorEscape builds the ANSI escape sequence for a 0x03 color code
+// with the given (possibly empty) foreground/background mIRC indexes.
+func ansiColorEscape(fg, bg string) string {
+	if fg == "" && bg == "" {
+		return ansiReset
 	}
+	if len(fg) == 1 {
+		fg = "0" + fg
+	}
+	if len(bg) == 1 {
+		bg = "0" + bg
+	}
+
+	parts := make([]string, 0, 2)
+	if code, ok := ircToANSIFg[fg]; ok {
+		parts = append(parts, code)
+	}
+	if code, ok := ircToANSIFg[bg]; ok {
+		parts = append(parts, ansiBgFromFg(code))
+	}
+	if len(parts) == 0 {
+		return ansiReset
+	}
+
+	return "\x1b[" + strings.Join(parts, ";") + "m"
+}
 
-	return text
+// ansiBgFromFg converts an ANSI foreground SGR parameter ("30"-"37" or
+// "90"-"97") to its background equivalent ("40"-"47" or "100"-"107").
+func ansiBgFromFg(fg string) string {
+	n, _ := strconv.Atoi(fg)
+	return strconv.Itoa(n + 10)
 }
 
 // IsValidChannel validates if channel is an RFC complaint channel or not.
@@ -0,0 +1,342 @@
+// Copyright (c) Liam Stanley <me@liamstanley.io>. All rights reserved. Use
+// of this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package girc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModeKind describes how a channel mode letter behaves when it's toggled,
+// per the server's "CHANMODES=A,B,C,D" ISUPPORT token.
+type ModeKind int
+
+const (
+	// ModeKindList modes (type A) take a parameter both when set and
+	// unset, and represent a list, e.g. "+b" (ban).
+	ModeKindList ModeKind = iota
+	// ModeKindParam modes (type B) always take a parameter, e.g. "+k"
+	// (key).
+	ModeKindParam
+	// ModeKindSetParam modes (type C) take a parameter only when being
+	// set, e.g. "+l" (limit).
+	ModeKindSetParam
+	// ModeKindFlag modes (type D) never take a parameter, e.g. "+m"
+	// (moderated).
+	ModeKindFlag
+)
+
+// ChanModes holds a server's parsed CHANMODES and PREFIX ISUPPORT tokens,
+// describing how to interpret MODE changes for that server.
+type ChanModes struct {
+	// Types maps a channel mode letter to its ModeKind.
+	Types map[byte]ModeKind
+	// Prefixes maps a user-mode letter (e.g. 'o') to its display prefix
+	// (e.g. '@').
+	Prefixes map[byte]byte
+	// PrefixOrder lists user-mode letters from highest to lowest
+	// priority, matching the order of the server's PREFIX token.
+	PrefixOrder []byte
+}
+
+// ParseCHANMODES parses a server's "CHANMODES=A,B,C,D" ISUPPORT value into
+// a mode-letter -> ModeKind table.
+func ParseCHANMODES(raw string) (map[byte]ModeKind, error) {
+	groups := strings.Split(raw, ",")
+	if len(groups) != 4 {
+		return nil, fmt.Errorf("girc: malformed CHANMODES value %q", raw)
+	}
+
+	kinds := [4]ModeKind{ModeKindList, ModeKindParam, ModeKindSetParam, ModeKindFlag}
+
+	types := make(map[byte]ModeKind)
+	for i, group := range groups {
+		for j := 0; j < len(group); j++ {
+			types[group[j]] = kinds[i]
+		}
+	}
+
+	return types, nil
+}
+
+// ParsePREFIX parses a server's "PREFIX=(ov)@+" ISUPPORT value into a
+// mode-letter -> prefix-symbol table, and the priority-ordered list of
+// mode letters.
+func ParsePREFIX(raw string) (prefixes map[byte]byte, order []byte, err error) {
+	if len(raw) < 2 || raw[0] != '(' {
+		return nil, nil, fmt.Errorf("girc: malformed PREFIX value %q", raw)
+	}
+
+	close := strings.IndexByte(raw, ')')
+	if close == -1 {
+		return nil, nil, fmt.Errorf("girc: malformed PREFIX value %q", raw)
+	}
+
+	letters, symbols := raw[1:close], raw[close+1:]
+	if len(letters) != len(symbols) {
+		return nil, nil, fmt.Errorf("girc: PREFIX letters/symbols length mismatch in %q", raw)
+	}
+
+	prefixes = make(map[byte]byte, len(letters))
+	for i := 0; i < len(letters); i++ {
+		prefixes[letters[i]] = symbols[i]
+	}
+
+	return prefixes, []byte(letters), nil
+}
+
+// NewChanModes builds a *ChanModes from the server's raw CHANMODES and
+// PREFIX ISUPPORT values.
+func NewChanModes(chanmodes, prefix string) (*ChanModes, error) {
+	types, err := ParseCHANMODES(chanmodes)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes, order, err := ParsePREFIX(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChanModes{Types: types, Prefixes: prefixes, PrefixOrder: order}, nil
+}
+
+// kind reports the ModeKind of letter, and whether it's actually a
+// user-prefix mode (e.g. 'o'/'v') rather than a plain channel mode.
+func (t *ChanModes) kind(letter byte) (kind ModeKind, isPrefix, ok bool) {
+	if _, isPrefix = t.Prefixes[letter]; isPrefix {
+		return 0, true, true
+	}
+
+	kind, ok = t.Types[letter]
+	return kind, false, ok
+}
+
+// rank returns letter's priority index within PrefixOrder (lower is
+// higher priority), or len(PrefixOrder) if it isn't a prefix mode.
+func (t *ChanModes) rank(letter byte) int {
+	for i, p := range t.PrefixOrder {
+		if p == letter {
+			return i
+		}
+	}
+
+	return len(t.PrefixOrder)
+}
+
+// Channel tracks the mode state of a single IRC channel.
+type Channel struct {
+	Name string
+	// Modes maps a set channel mode letter to its parameter (empty
+	// string for modes that take none).
+	Modes map[byte]string
+	// Lists holds type-A (list) mode entries, e.g. Lists['b'] for bans.
+	Lists map[byte][]string
+}
+
+// NewChannel returns an empty Channel for the given name.
+func NewChannel(name string) *Channel {
+	return &Channel{Name: name, Modes: make(map[byte]string), Lists: make(map[byte][]string)}
+}
+
+// User tracks per-channel prefix state for a single nickname.
+type User struct {
+	Nick string
+
+	channelModes map[string]string
+}
+
+// NewUser returns an empty User for the given nickname.
+func NewUser(nick string) *User {
+	return &User{Nick: nick, channelModes: make(map[string]string)}
+}
+
+// ChannelModes returns the concatenated prefix-mode letters (e.g. "ov")
+// that User holds in channel, highest-priority first. It returns "" if
+// the user holds no prefix modes there.
+func (u *User) ChannelModes(channel string) string {
+	return u.channelModes[channel]
+}
+
+// ModeString applies raw MODE command parameters against a Channel (and
+// its Users), per a server's ChanModes table, and records a MODE_CHANGED
+// Event for each individual toggle applied.
+type ModeString struct {
+	Table   *ChanModes
+	Channel *Channel
+	// Users maps nickname to *User, for resolving prefix-mode targets.
+	// Unknown nicknames are created on demand.
+	Users map[string]*User
+
+	// Events accumulates one MODE_CHANGED Event per toggle applied by
+	// the most recent call to Apply.
+	Events []*Event
+}
+
+// NewModeString returns a ModeString ready to apply changes to channel.
+func NewModeString(table *ChanModes, channel *Channel) *ModeString {
+	return &ModeString{Table: table, Channel: channel, Users: make(map[string]*User)}
+}
+
+// Apply walks a raw MODE modestring plus its parameters (space-separated,
+// e.g. "+ov-b nick1 nick2 *!*@banned.example.com"), applying each +/-
+// toggle to Channel/Users according to the CHANMODES/PREFIX table, and
+// appending a synthetic MODE_CHANGED Event to m.Events for each one.
+func (m *ModeString) Apply(s string) error {
+	m.Events = nil
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return errors.New("girc: empty mode string")
+	}
+
+	modestring, args := fields[0], fields[1:]
+	argi := 0
+	adding := true
+
+	for i := 0; i < len(modestring); i++ {
+		c := modestring[i]
+
+		switch c {
+		case '+':
+			adding = true
+			continue
+		case '-':
+			adding = false
+			continue
+		}
+
+		kind, isPrefix, ok := m.Table.kind(c)
+		if !ok && !isPrefix {
+			return fmt.Errorf("girc: unknown channel mode %q", string(c))
+		}
+
+		switch {
+		case isPrefix:
+			nick, err := nextArg(args, &argi)
+			if err != nil {
+				return err
+			}
+			m.applyPrefix(c, nick, adding)
+		case kind == ModeKindList:
+			mask, err := nextArg(args, &argi)
+			if err != nil {
+				return err
+			}
+			m.applyList(c, mask, adding)
+		case kind == ModeKindParam:
+			val, err := nextArg(args, &argi)
+			if err != nil {
+				return err
+			}
+			m.applyParam(c, val, adding)
+		case kind == ModeKindSetParam:
+			if adding {
+				val, err := nextArg(args, &argi)
+				if err != nil {
+					return err
+				}
+				m.applyParam(c, val, adding)
+			} else {
+				m.applyParam(c, "", adding)
+			}
+		default: // ModeKindFlag
+			m.applyParam(c, "", adding)
+		}
+	}
+
+	return nil
+}
+
+func nextArg(args []string, argi *int) (string, error) {
+	if *argi >= len(args) {
+		return "", errors.New("girc: mode change missing expected parameter")
+	}
+
+	arg := args[*argi]
+	*argi++
+	return arg, nil
+}
+
+func (m *ModeString) applyPrefix(letter byte, nick string, adding bool) {
+	u, ok := m.Users[nick]
+	if !ok {
+		u = NewUser(nick)
+		m.Users[nick] = u
+	}
+
+	cur := u.channelModes[m.Channel.Name]
+	if adding {
+		if !strings.ContainsRune(cur, rune(letter)) {
+			cur = m.Table.sortPrefixes(cur + string(letter))
+		}
+	} else {
+		cur = strings.Replace(cur, string(letter), "", 1)
+	}
+	u.channelModes[m.Channel.Name] = cur
+
+	m.emit(letter, adding, nick)
+}
+
+func (t *ChanModes) sortPrefixes(s string) string {
+	b := []byte(s)
+	sort.Slice(b, func(i, j int) bool { return t.rank(b[i]) < t.rank(b[j]) })
+	return string(b)
+}
+
+func (m *ModeString) applyList(letter byte, mask string, adding bool) {
+	list := m.Channel.Lists[letter]
+
+	if adding {
+		alreadyListed := false
+		for _, entry := range list {
+			if entry == mask {
+				alreadyListed = true
+				break
+			}
+		}
+		if !alreadyListed {
+			m.Channel.Lists[letter] = append(list, mask)
+		}
+		// Re-asserting an existing entry (e.g. a ban replayed after a
+		// netsplit) still emits below, consistent with applyPrefix and
+		// applyParam always emitting on a toggle.
+	} else {
+		for i, entry := range list {
+			if entry == mask {
+				m.Channel.Lists[letter] = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+	}
+
+	m.emit(letter, adding, mask)
+}
+
+func (m *ModeString) applyParam(letter byte, val string, adding bool) {
+	if adding {
+		m.Channel.Modes[letter] = val
+	} else {
+		delete(m.Channel.Modes, letter)
+	}
+
+	m.emit(letter, adding, val)
+}
+
+// emit appends a synthetic MODE_CHANGED event describing a single
+// applied toggle.
+func (m *ModeString) emit(letter byte, adding bool, param string) {
+	sign := "+"
+	if !adding {
+		sign = "-"
+	}
+
+	m.Events = append(m.Events, &Event{
+		Command: "MODE_CHANGED",
+		Params:  []string{m.Channel.Name, sign + string(letter), param},
+	})
+}
@@ -0,0 +1,350 @@
+// Copyright (c) Liam Stanley <me@liamstanley.io>. All rights reserved. Use
+// of this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package girc
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Source represents the sender of an IRC event -- usually either a
+// server, or a user in "nick!user@host" form.
+type Source struct {
+	// Name is either the nickname of the user, or the name of the
+	// server that generated the event.
+	Name string
+	// Ident is the user's ident/username. Empty for server sources.
+	Ident string
+	// Host is the user's hostname. Empty for server sources.
+	Host string
+}
+
+// IsHostmask returns true if the source looks like a user, rather than a
+// bare server name.
+func (s *Source) IsHostmask() bool {
+	return len(s.Ident) > 0 && len(s.Host) > 0
+}
+
+// String returns the source in "nick!user@host" form, or just the name if
+// this source doesn't carry ident/host information.
+func (s *Source) String() string {
+	if !s.IsHostmask() {
+		return s.Name
+	}
+
+	return s.Name + "!" + s.Ident + "@" + s.Host
+}
+
+// ParseSource parses a raw IRC source/prefix, e.g. "nick!user@host" or
+// "irc.example.com", into a *Source.
+func ParseSource(raw string) *Source {
+	src := &Source{}
+
+	uh := strings.IndexByte(raw, '!')
+	hs := strings.IndexByte(raw, '@')
+
+	switch {
+	case uh > 0 && hs > uh:
+		src.Name = raw[:uh]
+		src.Ident = raw[uh+1 : hs]
+		src.Host = raw[hs+1:]
+	case hs > 0:
+		src.Name = raw[:hs]
+		src.Host = raw[hs+1:]
+	default:
+		src.Name = raw
+	}
+
+	return src
+}
+
+// Tags represents a set of IRCv3 message tags, e.g. from a line like:
+//
+//   @time=2019-02-23T10:19:00.000Z;msgid=abc123 :nick!user@host PRIVMSG #chan :hi
+type Tags map[string]string
+
+const (
+	// maxTagData is the maximum byte length of the tag portion of a
+	// message sent by the client (everything between "@" and the
+	// following space), per the IRCv3 message-tags spec.
+	maxTagData = 8191
+	// maxServerTagData is the maximum byte length of the tag portion of
+	// a message coming from the server.
+	maxServerTagData = 4094
+)
+
+// ErrTagsTooLong is returned by ParseTags and ParseServerTags when the tag
+// data exceeds the IRCv3 length limit each of them enforces.
+var ErrTagsTooLong = errors.New("girc: tag data exceeds the IRCv3 length limit")
+
+// ErrInvalidTagKey is returned by ParseTags when a tag key doesn't match
+// the IRCv3 grammar.
+var ErrInvalidTagKey = errors.New("girc: invalid tag key")
+
+// ParseTags parses the leading "@key=val;key2=val2 " portion of an IRC
+// line, if present, returning the parsed Tags and the remainder of the
+// line (with the tag portion and its separating space removed). If raw
+// does not begin with "@", it returns nil tags and raw unmodified.
+//
+// The 8191-byte client-tag limit from the IRCv3 spec is enforced; use
+// ParseServerTags instead for lines received from a server, which are
+// held to the stricter 4094-byte server-tag limit.
+func ParseTags(raw string) (Tags, string, error) {
+	return parseTags(raw, maxTagData)
+}
+
+// ParseServerTags is identical to ParseTags, except it enforces the
+// stricter 4094-byte server-tag length limit from the IRCv3 spec, which
+// is what the event decoder expects of lines actually received from a
+// server.
+func ParseServerTags(raw string) (Tags, string, error) {
+	return parseTags(raw, maxServerTagData)
+}
+
+func parseTags(raw string, limit int) (Tags, string, error) {
+	if len(raw) == 0 || raw[0] != '@' {
+		return nil, raw, nil
+	}
+
+	end := strings.IndexByte(raw, ' ')
+	if end == -1 {
+		end = len(raw)
+	}
+
+	data := raw[1:end]
+	if len(data) > limit {
+		return nil, raw, ErrTagsTooLong
+	}
+
+	rest := strings.TrimLeft(raw[end:], " ")
+
+	tags := make(Tags)
+	for _, pair := range strings.Split(data, ";") {
+		if pair == "" {
+			continue
+		}
+
+		key, val, _ := strings.Cut(pair, "=")
+		if !validTagKey(key) {
+			return nil, raw, ErrInvalidTagKey
+		}
+
+		tags[key] = unescapeTagValue(val)
+	}
+
+	return tags, rest, nil
+}
+
+// validTagKey reports whether key matches the IRCv3 tag key grammar:
+// an optional leading "+" (client-only tag), an optional
+// "vendor.tld/" prefix, followed by one or more [A-Za-z0-9-._/].
+func validTagKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	if key[0] == '+' {
+		key = key[1:]
+	}
+	if key == "" {
+		return false
+	}
+
+	if idx := strings.IndexByte(key, '/'); idx != -1 {
+		if idx == 0 || idx == len(key)-1 {
+			return false
+		}
+		key = key[:idx] + key[idx+1:]
+	}
+
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c >= 'A' && c <= 'Z':
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9':
+		case c == '-' || c == '.' || c == '_' || c == '/':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// unescapeTagValue un-escapes the IRCv3 tag-value escape sequences:
+// "\:" -> ";", "\s" -> " ", "\\" -> "\", "\r" -> CR, "\n" -> LF. A
+// trailing, unmatched "\" is dropped per spec.
+func unescapeTagValue(val string) string {
+	if !strings.ContainsRune(val, '\\') {
+		return val
+	}
+
+	var out strings.Builder
+	out.Grow(len(val))
+
+	for i := 0; i < len(val); i++ {
+		if val[i] != '\\' || i+1 >= len(val) {
+			if val[i] == '\\' {
+				// Trailing unescaped backslash -- drop it.
+				break
+			}
+			out.WriteByte(val[i])
+			continue
+		}
+
+		switch val[i+1] {
+		case ':':
+			out.WriteByte(';')
+		case 's':
+			out.WriteByte(' ')
+		case '\\':
+			out.WriteByte('\\')
+		case 'r':
+			out.WriteByte('\r')
+		case 'n':
+			out.WriteByte('\n')
+		default:
+			// Unknown escape -- per spec, drop the backslash and keep
+			// the following character as-is.
+			out.WriteByte(val[i+1])
+		}
+		i++
+	}
+
+	return out.String()
+}
+
+// escapeTagValue is the inverse of unescapeTagValue, used by Tags.String().
+func escapeTagValue(val string) string {
+	var out strings.Builder
+	out.Grow(len(val))
+
+	for i := 0; i < len(val); i++ {
+		switch val[i] {
+		case ';':
+			out.WriteString(`\:`)
+		case ' ':
+			out.WriteString(`\s`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '\n':
+			out.WriteString(`\n`)
+		default:
+			out.WriteByte(val[i])
+		}
+	}
+
+	return out.String()
+}
+
+// String re-encodes the tags back into "key=val;key2=val2" wire form,
+// escaping values as needed. It does not include the leading "@" or
+// trailing space.
+func (t Tags) String() string {
+	if len(t) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(t))
+	for k, v := range t {
+		if v == "" {
+			parts = append(parts, k)
+			continue
+		}
+		parts = append(parts, k+"="+escapeTagValue(v))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Event represents a single parsed IRC protocol line.
+type Event struct {
+	// Tags holds any IRCv3 message tags present on the line.
+	Tags Tags
+	// Source is the sender of the event, if any (e.g. absent on lines
+	// the client itself generates before sending).
+	Source *Source
+	// Command is the IRC command or numeric, e.g. "PRIVMSG" or "001".
+	Command string
+	// Params holds the command parameters, including the trailing
+	// (":"-prefixed) parameter as its own, final element.
+	Params []string
+}
+
+// ParseEvent parses a single raw IRC protocol line (sans trailing CRLF)
+// into an Event, including any IRCv3 message tags and the source prefix.
+func ParseEvent(raw string) (*Event, error) {
+	raw = strings.TrimRight(raw, "\r\n")
+	if raw == "" {
+		return nil, errors.New("girc: empty event")
+	}
+
+	tags, raw, err := ParseServerTags(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{Tags: tags}
+
+	if len(raw) > 0 && raw[0] == ':' {
+		end := strings.IndexByte(raw, ' ')
+		if end == -1 {
+			return nil, errors.New("girc: event missing command after source")
+		}
+		event.Source = ParseSource(raw[1:end])
+		raw = strings.TrimLeft(raw[end:], " ")
+	}
+
+	for raw != "" {
+		if raw[0] == ':' {
+			event.Params = append(event.Params, raw[1:])
+			break
+		}
+
+		end := strings.IndexByte(raw, ' ')
+		if end == -1 {
+			event.Params = append(event.Params, raw)
+			break
+		}
+
+		event.Params = append(event.Params, raw[:end])
+		raw = strings.TrimLeft(raw[end:], " ")
+	}
+
+	if len(event.Params) == 0 {
+		return nil, errors.New("girc: event missing command")
+	}
+	event.Command = strings.ToUpper(event.Params[0])
+	event.Params = event.Params[1:]
+
+	return event, nil
+}
+
+// ServerTime returns the value of the "time" message tag (the IRCv3
+// server-time capability), parsed as RFC3339. The second return value is
+// false if the tag is absent or malformed.
+func (e *Event) ServerTime() (time.Time, bool) {
+	raw, ok := e.Tags["time"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// MsgID returns the value of the "msgid" message tag, or an empty string
+// if it is absent.
+func (e *Event) MsgID() string {
+	return e.Tags["msgid"]
+}
@@ -0,0 +1,216 @@
+// Copyright (c) Liam Stanley <me@liamstanley.io>. All rights reserved. Use
+// of this source code is governed by the MIT license that can be found in
+// the LICENSE file.
+
+package girc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// WebIRC holds the parameters for a "WEBIRC" line, sent before NICK/USER
+// so that a gateway or bouncer (e.g. a web client, or a soju-style
+// bouncer) can forward the real client's host/IP to the upstream server,
+// rather than appearing as the gateway's own connection.
+type WebIRC struct {
+	// Password is the shared secret the upstream server expects for
+	// this gateway.
+	Password string
+	// Gateway is the name of the gateway/bouncer software, e.g. "kiwiirc".
+	Gateway string
+	// Hostname is the real client's hostname (or its IP, if no reverse
+	// DNS is available).
+	Hostname string
+	// IP is the real client's IP address.
+	IP string
+	// Flags carries optional trailing WEBIRC flags, e.g. "secure" to
+	// indicate the client's connection to the gateway was itself TLS.
+	Flags []string
+}
+
+// Line builds the raw "WEBIRC <password> <gateway> <hostname> <ip>
+// [flags...]" line to send prior to NICK/USER.
+func (w *WebIRC) Line() (string, error) {
+	if w.Password == "" || w.Gateway == "" || w.Hostname == "" || w.IP == "" {
+		return "", errors.New("girc: WebIRC requires Password, Gateway, Hostname, and IP")
+	}
+
+	parts := []string{"WEBIRC", w.Password, w.Gateway, w.Hostname, w.IP}
+	parts = append(parts, w.Flags...)
+
+	return strings.Join(parts, " "), nil
+}
+
+// SpoofIdent is invoked for each incoming ident (RFC 1413) query on behalf
+// of a connection this process initiated, identified by the local/remote
+// TCP port pair the upstream server observed. It returns the username to
+// report, and whether a response should be sent at all.
+type SpoofIdent func(localPort, remotePort int) (username string, ok bool)
+
+// IdentServer answers RFC 1413 ident queries on port 113, so that an IRC
+// server asking "who connected to you on this port" gets back a
+// configured username instead of timing out or hitting an unfiltered
+// system ident daemon. Most processes need elevated privileges (or
+// CAP_NET_BIND_SERVICE) to bind port 113; when that's not available,
+// callers can still call the SpoofIdent hook directly to answer queries
+// received some other way (e.g. proxied from a privileged helper).
+type IdentServer struct {
+	hook     SpoofIdent
+	listener net.Listener
+}
+
+// NewIdentServer returns an IdentServer that answers queries using hook.
+func NewIdentServer(hook SpoofIdent) *IdentServer {
+	return &IdentServer{hook: hook}
+}
+
+// Listen binds port 113, so that Serve can start answering ident
+// queries. Split from Serve so callers (e.g. Client.StartIdent) can
+// surface a bind failure before handing the blocking accept loop off to
+// a goroutine.
+func (s *IdentServer) Listen() error {
+	ln, err := net.Listen("tcp", ":113")
+	if err != nil {
+		return fmt.Errorf("girc: binding ident server: %w", err)
+	}
+	s.listener = ln
+	return nil
+}
+
+// Serve answers ident queries on the listener bound by Listen, until
+// Close is called.
+func (s *IdentServer) Serve() error {
+	if s.listener == nil {
+		return errors.New("girc: ident server: Listen was not called")
+	}
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// ListenAndServe binds port 113 and answers ident queries until Close is
+// called.
+func (s *IdentServer) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Close stops the ident server, if it's running.
+func (s *IdentServer) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *IdentServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		return
+	}
+
+	local, remote, err := parseIdentQuery(scanner.Text())
+	if err != nil {
+		return
+	}
+
+	username, ok := s.hook(local, remote)
+	if !ok {
+		fmt.Fprintf(conn, "%d, %d : ERROR : NO-USER\r\n", local, remote)
+		return
+	}
+
+	fmt.Fprintf(conn, "%d, %d : USERID : UNIX : %s\r\n", local, remote, username)
+}
+
+// parseIdentQuery parses a raw "<local-port>, <remote-port>" ident query.
+func parseIdentQuery(line string) (local, remote int, err error) {
+	parts := strings.SplitN(line, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("girc: malformed ident query %q", line)
+	}
+
+	if _, err = fmt.Sscanf(strings.TrimSpace(parts[0]), "%d", &local); err != nil {
+		return 0, 0, err
+	}
+	if _, err = fmt.Sscanf(strings.TrimSpace(parts[1]), "%d", &remote); err != nil {
+		return 0, 0, err
+	}
+
+	return local, remote, nil
+}
+
+// SourceRewriteFunc rewrites an inbound event's Source, e.g. in response
+// to an IRCv3 "account" tag or a CHGHOST event. Returning the input
+// unchanged leaves the source as-is.
+type SourceRewriteFunc func(*Source) *Source
+
+// SourceRewriter chains zero or more SourceRewriteFuncs, applied in
+// registration order. This is the middleware intended to back
+// Client.RewriteSource, for bouncer setups that multiplex many real
+// users behind one TCP connection and need to present each event under
+// its true source rather than the bouncer's shared connection identity.
+type SourceRewriter struct {
+	fns []SourceRewriteFunc
+}
+
+// Use registers fn to run on every call to Rewrite, after any
+// previously-registered funcs.
+func (r *SourceRewriter) Use(fn SourceRewriteFunc) {
+	r.fns = append(r.fns, fn)
+}
+
+// Rewrite runs src through every registered SourceRewriteFunc in order,
+// returning the (possibly replaced) result.
+func (r *SourceRewriter) Rewrite(src *Source) *Source {
+	for _, fn := range r.fns {
+		src = fn(src)
+	}
+	return src
+}
+
+// RewriteFromAccountTag returns a SourceRewriteFunc that, given an
+// event's "account" tag value, replaces the source's Name with the
+// authenticated account name -- useful when a bouncer's nick differs
+// from the account it's authenticated as.
+func RewriteFromAccountTag(account string) SourceRewriteFunc {
+	return func(src *Source) *Source {
+		if account == "" || account == "*" || src == nil {
+			return src
+		}
+
+		rewritten := *src
+		rewritten.Name = account
+		return &rewritten
+	}
+}
+
+// RewriteFromCHGHOST returns a SourceRewriteFunc that applies a CHGHOST
+// change (new ident/host) to a source with a matching Name.
+func RewriteFromCHGHOST(nick, newIdent, newHost string) SourceRewriteFunc {
+	return func(src *Source) *Source {
+		if src == nil || src.Name != nick {
+			return src
+		}
+
+		rewritten := *src
+		rewritten.Ident = newIdent
+		rewritten.Host = newHost
+		return &rewritten
+	}
+}